@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/teambition/rrule-go"
+)
+
+// caldavProvider implements EventProvider against an RFC 4791 CalDAV server
+// (Nextcloud, Radicale, Fastmail, iCloud, ...). It discovers the current
+// user's calendar-home-set via PROPFIND once, then lists events via a
+// calendar-query REPORT scoped to the requested time window.
+type caldavProvider struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	homeSetMu sync.Mutex
+	homeSet   string
+}
+
+// newCaldavProvider builds a caldavProvider talking to baseURL, optionally
+// authenticating with HTTP Basic auth.
+func newCaldavProvider(baseURL, username, password string) *caldavProvider {
+	return &caldavProvider{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		client:   http.DefaultClient,
+	}
+}
+
+// newCaldavProviderFromEnv builds a caldavProvider and its calendarConfig
+// from GCALJSON_CALDAV_URL (the server's base or principal URL),
+// GCALJSON_CALDAV_USERNAME/GCALJSON_CALDAV_PASSWORD (HTTP Basic auth) and
+// GCALJSON_CALDAV_CALENDARS (a comma-separated allowlist of calendar paths,
+// resolved relative to the discovered calendar-home-set, or absolute URLs).
+func newCaldavProviderFromEnv() (*caldavProvider, calendarConfig, error) {
+	baseURL := os.Getenv("GCALJSON_CALDAV_URL")
+	calendarsEnv := os.Getenv("GCALJSON_CALDAV_CALENDARS")
+	if baseURL == "" || calendarsEnv == "" {
+		return nil, calendarConfig{}, fmt.Errorf("GCALJSON_CALDAV_URL と GCALJSON_CALDAV_CALENDARS を設定してください")
+	}
+
+	cfg := parseCalendarConfig(calendarsEnv)
+	if len(cfg.allowed) == 0 {
+		return nil, calendarConfig{}, fmt.Errorf("GCALJSON_CALDAV_CALENDARS に有効なカレンダーを指定してください")
+	}
+
+	provider := newCaldavProvider(baseURL, os.Getenv("GCALJSON_CALDAV_USERNAME"), os.Getenv("GCALJSON_CALDAV_PASSWORD"))
+	return provider, cfg, nil
+}
+
+// caldavPrincipalBody requests the current user's principal URL.
+const caldavPrincipalBody = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop><D:current-user-principal/></D:prop>
+</D:propfind>`
+
+// caldavHomeSetBody requests the principal's calendar-home-set.
+const caldavHomeSetBody = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><C:calendar-home-set/></D:prop>
+</D:propfind>`
+
+// caldavResourcetypeBody is a minimal PROPFIND used by HealthCheck to confirm
+// a calendar URL is reachable and authenticated without listing any events.
+const caldavResourcetypeBody = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop><D:resourcetype/></D:prop>
+</D:propfind>`
+
+// caldavReportBody requests VEVENTs within [start, end] for a single calendar.
+const caldavReportBody = `<?xml version="1.0" encoding="utf-8" ?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><C:calendar-data/></D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%s" end="%s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+
+// davMultistatus is the subset of a DAV multistatus response this provider
+// needs: the href and calendar-specific properties of each <response>.
+type davMultistatus struct {
+	Responses []davResponse `xml:"response"`
+}
+
+type davResponse struct {
+	Propstats []davPropstat `xml:"propstat"`
+}
+
+type davPropstat struct {
+	Prop davProp `xml:"prop"`
+}
+
+type davProp struct {
+	Principal    davHref `xml:"current-user-principal"`
+	HomeSet      davHref `xml:"calendar-home-set"`
+	CalendarData string  `xml:"calendar-data"`
+}
+
+type davHref struct {
+	Href string `xml:"href"`
+}
+
+// propfind issues a PROPFIND request with Depth: 0 against url and decodes
+// the multistatus response body.
+func (p *caldavProvider) propfind(ctx context.Context, reqURL, body string) (*davMultistatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", reqURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "0")
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("caldav: PROPFIND %s: unexpected status %s", reqURL, resp.Status)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("caldav: decoding PROPFIND response: %w", err)
+	}
+	return &ms, nil
+}
+
+// discoverHomeSet resolves the current user's calendar-home-set by chaining
+// two PROPFINDs: one against baseURL for current-user-principal, then one
+// against the principal URL for calendar-home-set.
+func (p *caldavProvider) discoverHomeSet(ctx context.Context) (string, error) {
+	principalMS, err := p.propfind(ctx, p.baseURL, caldavPrincipalBody)
+	if err != nil {
+		return "", fmt.Errorf("caldav: discovering principal: %w", err)
+	}
+	principalHref, err := findHref(principalMS, func(prop davProp) string { return prop.Principal.Href })
+	if err != nil {
+		return "", fmt.Errorf("caldav: discovering principal: %w", err)
+	}
+	principalURL, err := resolveHref(p.baseURL, principalHref)
+	if err != nil {
+		return "", err
+	}
+
+	homeSetMS, err := p.propfind(ctx, principalURL, caldavHomeSetBody)
+	if err != nil {
+		return "", fmt.Errorf("caldav: discovering calendar-home-set: %w", err)
+	}
+	homeSetHref, err := findHref(homeSetMS, func(prop davProp) string { return prop.HomeSet.Href })
+	if err != nil {
+		return "", fmt.Errorf("caldav: discovering calendar-home-set: %w", err)
+	}
+	return resolveHref(p.baseURL, homeSetHref)
+}
+
+// resolveHomeSet discovers and caches the calendar-home-set URL, since it
+// doesn't change at runtime. A failed discovery is not cached: a transient
+// PROPFIND error shouldn't permanently wedge the provider, so the next List
+// call simply retries the discovery.
+func (p *caldavProvider) resolveHomeSet(ctx context.Context) (string, error) {
+	p.homeSetMu.Lock()
+	defer p.homeSetMu.Unlock()
+	if p.homeSet != "" {
+		return p.homeSet, nil
+	}
+	homeSet, err := p.discoverHomeSet(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.homeSet = homeSet
+	return p.homeSet, nil
+}
+
+// calendarURL resolves a configured calendar ID to an absolute URL: IDs that
+// are already absolute URLs are used as-is, everything else is resolved
+// relative to the discovered calendar-home-set.
+func (p *caldavProvider) calendarURL(ctx context.Context, calendarID string) (string, error) {
+	if strings.HasPrefix(calendarID, "http://") || strings.HasPrefix(calendarID, "https://") {
+		return calendarID, nil
+	}
+	homeSet, err := p.resolveHomeSet(ctx)
+	if err != nil {
+		return "", err
+	}
+	return resolveHref(homeSet, calendarID)
+}
+
+// HealthCheck implements EventProvider by resolving calendarID's URL (which
+// exercises home-set discovery) and issuing a minimal PROPFIND against it, to
+// confirm the server is reachable and the configured credentials still work.
+func (p *caldavProvider) HealthCheck(ctx context.Context, calendarID string) error {
+	calURL, err := p.calendarURL(ctx, calendarID)
+	if err != nil {
+		return err
+	}
+	_, err = p.propfind(ctx, calURL, caldavResourcetypeBody)
+	return err
+}
+
+func findHref(ms *davMultistatus, get func(davProp) string) (string, error) {
+	for _, resp := range ms.Responses {
+		for _, ps := range resp.Propstats {
+			if href := get(ps.Prop); href != "" {
+				return href, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("property not found in PROPFIND response")
+}
+
+func resolveHref(base, href string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("caldav: invalid URL %q: %w", base, err)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("caldav: invalid URL %q: %w", href, err)
+	}
+	return baseURL.ResolveReference(ref).String(), nil
+}
+
+// List implements EventProvider by issuing a calendar-query REPORT scoped to
+// eq's time window, then parsing each returned VEVENT into an Event. A
+// recurring series is typically returned as one calendar-data blob holding
+// the master VEVENT plus one VEVENT per overridden occurrence (sharing the
+// master's UID, distinguished by RECURRENCE-ID). If raw is true, masters keep
+// their RRULE/EXDATE/RDATE in Event.RRule for iCal output, and are dropped if
+// they have no occurrence in the window. If raw is false, masters are
+// expanded into individual occurrence Events instead — CalDAV has no
+// Google-style "single events" mode, so this provider does the expansion
+// itself, skipping any occurrence that has its own override VEVENT.
+func (p *caldavProvider) List(ctx context.Context, calendarID string, raw bool, eq eventQuery) ([]Event, error) {
+	calURL, err := p.calendarURL(ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	body := fmt.Sprintf(caldavReportBody,
+		eq.timeMin.UTC().Format(rrule.DateTimeFormat), eq.timeMax.UTC().Format(rrule.DateTimeFormat))
+	req, err := http.NewRequestWithContext(ctx, "REPORT", calURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("caldav: REPORT %s: unexpected status %s", calURL, resp.Status)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("caldav: decoding REPORT response: %w", err)
+	}
+
+	var events []Event
+	for _, resp := range ms.Responses {
+		for _, ps := range resp.Propstats {
+			if ps.Prop.CalendarData == "" {
+				continue
+			}
+			cal, err := ical.NewDecoder(strings.NewReader(ps.Prop.CalendarData)).Decode()
+			if err != nil {
+				slog.Warn("caldav: skipping unparsable calendar-data", "error", err)
+				continue
+			}
+			for _, vevent := range cal.Events() {
+				// raw is always true here regardless of List's own raw
+				// parameter: pruneEmptyCaldavMasters/expandCaldavMasters
+				// both need Event.RRule populated on masters to do their
+				// job, and strip it back out again for non-raw callers.
+				ev, err := convertVEvent(vevent, true)
+				if err != nil {
+					slog.Warn("caldav: skipping event", "error", err)
+					continue
+				}
+				events = append(events, ev)
+			}
+		}
+	}
+
+	if raw {
+		events, err = pruneEmptyCaldavMasters(events, eq)
+	} else {
+		events, err = expandCaldavMasters(events, eq)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filterCaldavEvents(events, eq), nil
+}
+
+// filterCaldavEvents applies eq.q and eq.maxResults to events, since (unlike
+// Events.List's Q()/MaxResults() on the Google side) the calendar-query
+// REPORT has no equivalent full-text or result-count filter to push down to
+// the server.
+func filterCaldavEvents(events []Event, eq eventQuery) []Event {
+	if eq.q != "" {
+		q := strings.ToLower(eq.q)
+		filtered := make([]Event, 0, len(events))
+		for _, ev := range events {
+			if strings.Contains(strings.ToLower(ev.Title), q) || strings.Contains(strings.ToLower(ev.Description), q) {
+				filtered = append(filtered, ev)
+			}
+		}
+		events = filtered
+	}
+	if eq.maxResults > 0 && int64(len(events)) > eq.maxResults {
+		events = events[:eq.maxResults]
+	}
+	return events
+}
+
+// pruneEmptyCaldavMasters drops recurring master events (Event.RRule set)
+// that have no occurrence within eq's window; everything else passes through
+// unchanged. Used for raw (iCal) output, which keeps RRULE text intact.
+func pruneEmptyCaldavMasters(events []Event, eq eventQuery) ([]Event, error) {
+	res := make([]Event, 0, len(events))
+	for _, ev := range events {
+		if ev.RRule != "" {
+			start, _, err := parseEventTime(ev.Start)
+			if err != nil {
+				return nil, fmt.Errorf("rrule: invalid start time for event %q: %w", ev.UID, err)
+			}
+			start = inEventLocation(start, ev.TimeZone)
+			occurrences, err := expandRecurrenceLines(start, strings.Split(ev.RRule, "\n"), eq.timeMin, eq.timeMax)
+			if err != nil {
+				return nil, err
+			}
+			if len(occurrences) == 0 {
+				continue
+			}
+		}
+		res = append(res, ev)
+	}
+	return res, nil
+}
+
+// expandCaldavMasters expands recurring master events (Event.RRule set) into
+// one Event per occurrence within eq's window, skipping occurrences that
+// already have their own override VEVENT (identified by UID+RecurrenceID).
+// Non-recurring events and overrides pass through unchanged, with RRule
+// cleared since the result only contains single, concrete instances.
+func expandCaldavMasters(events []Event, eq eventQuery) ([]Event, error) {
+	overridden := make(map[string]bool, len(events))
+	for _, ev := range events {
+		if ev.RecurrenceID != "" {
+			overridden[ev.UID+"|"+ev.RecurrenceID] = true
+		}
+	}
+
+	var res []Event
+	for _, ev := range events {
+		if ev.RRule == "" {
+			res = append(res, ev)
+			continue
+		}
+
+		start, allDay, err := parseEventTime(ev.Start)
+		if err != nil {
+			return nil, fmt.Errorf("rrule: invalid start time for event %q: %w", ev.UID, err)
+		}
+		end, _, err := parseEventTime(ev.End)
+		if err != nil {
+			return nil, fmt.Errorf("rrule: invalid end time for event %q: %w", ev.UID, err)
+		}
+		duration := end.Sub(start)
+		start = inEventLocation(start, ev.TimeZone)
+
+		occurrences, err := expandRecurrenceLines(start, strings.Split(ev.RRule, "\n"), eq.timeMin, eq.timeMax)
+		if err != nil {
+			return nil, err
+		}
+		for _, occ := range occurrences {
+			recurrenceID := formatEventTime(occ, allDay)
+			if overridden[ev.UID+"|"+recurrenceID] {
+				continue
+			}
+			instance := ev
+			instance.RRule = ""
+			instance.RecurrenceID = recurrenceID
+			instance.Start = formatEventTime(occ, allDay)
+			instance.End = formatEventTime(occ.Add(duration), allDay)
+			res = append(res, instance)
+		}
+	}
+	return res, nil
+}
+
+// convertVEvent converts a go-ical VEVENT into the module's Event type. If
+// raw is true, RRULE/EXDATE/RDATE are preserved in Event.RRule (as raw
+// "NAME:VALUE" lines, matching the format Google's item.Recurrence uses) for
+// reuse in iCal output.
+func convertVEvent(vevent ical.Event, raw bool) (Event, error) {
+	uidProp := vevent.Props.Get(ical.PropUID)
+	if uidProp == nil {
+		return Event{}, fmt.Errorf("event is missing a UID")
+	}
+	uid := uidProp.Value
+
+	startProp := vevent.Props.Get(ical.PropDateTimeStart)
+	if startProp == nil {
+		return Event{}, fmt.Errorf("event %q is missing DTSTART", uid)
+	}
+	start, err := propDateString(startProp)
+	if err != nil {
+		return Event{}, fmt.Errorf("event %q: invalid DTSTART: %w", uid, err)
+	}
+	end := start
+	if endProp := vevent.Props.Get(ical.PropDateTimeEnd); endProp != nil {
+		end, err = propDateString(endProp)
+		if err != nil {
+			return Event{}, fmt.Errorf("event %q: invalid DTEND: %w", uid, err)
+		}
+	}
+
+	ev := Event{
+		Title:       textValue(vevent.Props.Get(ical.PropSummary)),
+		Start:       start,
+		End:         end,
+		Description: textValue(vevent.Props.Get(ical.PropDescription)),
+		Location:    textValue(vevent.Props.Get(ical.PropLocation)),
+		UID:         uid,
+		Status:      textValue(vevent.Props.Get(ical.PropStatus)),
+		TimeZone:    startProp.Params.Get(ical.ParamTimezoneID),
+	}
+	if recurProp := vevent.Props.Get(ical.PropRecurrenceID); recurProp != nil {
+		recurrenceID, err := propDateString(recurProp)
+		if err != nil {
+			return Event{}, fmt.Errorf("event %q: invalid RECURRENCE-ID: %w", uid, err)
+		}
+		ev.RecurrenceID = recurrenceID
+	}
+	if raw {
+		ev.RRule = recurrenceLinesFromProps(vevent.Props)
+	}
+	return ev, nil
+}
+
+// propDateString formats an ical date/date-time property the same way
+// transformEvent formats Google event times: RFC3339 for a date-time value,
+// or "2006-01-02" for an all-day date value.
+func propDateString(prop *ical.Prop) (string, error) {
+	t, err := prop.DateTime(nil)
+	if err != nil {
+		return "", err
+	}
+	if prop.ValueType() == ical.ValueDate {
+		return t.Format("2006-01-02"), nil
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// textValue returns the unescaped text value of prop, or "" if prop is nil.
+func textValue(prop *ical.Prop) string {
+	if prop == nil {
+		return ""
+	}
+	v, err := prop.Text()
+	if err != nil {
+		return prop.Value
+	}
+	return v
+}
+
+// recurrenceLinesFromProps reconstructs RRULE/EXDATE/RDATE as raw
+// "NAME:VALUE" lines from a VEVENT's properties, in the same format
+// applyRecurrenceLines expects (and that transformEvent produces from
+// Google's item.Recurrence).
+func recurrenceLinesFromProps(props ical.Props) string {
+	var lines []string
+	if rruleProp := props.Get(ical.PropRecurrenceRule); rruleProp != nil {
+		lines = append(lines, ical.PropRecurrenceRule+":"+rruleProp.Value)
+	}
+	for _, p := range props[ical.PropExceptionDates] {
+		lines = append(lines, ical.PropExceptionDates+":"+p.Value)
+	}
+	for _, p := range props[ical.PropRecurrenceDates] {
+		lines = append(lines, ical.PropRecurrenceDates+":"+p.Value)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+func mustParseRFC3339(t *testing.T, s string) time.Time {
+	t.Helper()
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", s, err)
+	}
+	return tm
+}
+
+func TestFindHref(t *testing.T) {
+	const body = `<?xml version="1.0"?>
+<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:response>
+    <D:propstat>
+      <D:prop><D:current-user-principal><D:href>/principals/alice/</D:href></D:current-user-principal></D:prop>
+    </D:propstat>
+  </D:response>
+</D:multistatus>`
+
+	var ms davMultistatus
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	href, err := findHref(&ms, func(prop davProp) string { return prop.Principal.Href })
+	if err != nil {
+		t.Fatalf("findHref returned error: %v", err)
+	}
+	if href != "/principals/alice/" {
+		t.Errorf("expected /principals/alice/, got %q", href)
+	}
+
+	if _, err := findHref(&ms, func(prop davProp) string { return prop.HomeSet.Href }); err == nil {
+		t.Error("expected an error when the requested property is absent")
+	}
+}
+
+func TestResolveHref(t *testing.T) {
+	got, err := resolveHref("https://dav.example.com/dav", "/dav/calendars/alice/personal/")
+	if err != nil {
+		t.Fatalf("resolveHref returned error: %v", err)
+	}
+	want := "https://dav.example.com/dav/calendars/alice/personal/"
+	if got != want {
+		t.Errorf("resolveHref() = %q, want %q", got, want)
+	}
+
+	// An absolute href should be returned unchanged, ignoring the base.
+	got, err = resolveHref("https://dav.example.com/dav", "https://other.example.com/x")
+	if err != nil {
+		t.Fatalf("resolveHref returned error: %v", err)
+	}
+	if got != "https://other.example.com/x" {
+		t.Errorf("resolveHref() = %q, want unchanged absolute URL", got)
+	}
+}
+
+func TestConvertVEvent(t *testing.T) {
+	vevent := ical.NewEvent()
+	vevent.Props.SetText(ical.PropUID, "event-1@example.com")
+	vevent.Props.SetText(ical.PropSummary, "Standup")
+	vevent.Props.SetText(ical.PropDescription, "Daily sync")
+	vevent.Props.SetDateTime(ical.PropDateTimeStart, mustParseRFC3339(t, "2023-02-23T10:00:00Z"))
+	vevent.Props.SetDateTime(ical.PropDateTimeEnd, mustParseRFC3339(t, "2023-02-23T10:15:00Z"))
+	vevent.Props.Set(&ical.Prop{Name: ical.PropRecurrenceRule, Value: "FREQ=DAILY;COUNT=5"})
+
+	ev, err := convertVEvent(*vevent, true)
+	if err != nil {
+		t.Fatalf("convertVEvent returned error: %v", err)
+	}
+	if ev.UID != "event-1@example.com" {
+		t.Errorf("expected UID 'event-1@example.com', got %q", ev.UID)
+	}
+	if ev.Title != "Standup" {
+		t.Errorf("expected title 'Standup', got %q", ev.Title)
+	}
+	if ev.Start != "2023-02-23T10:00:00Z" {
+		t.Errorf("expected start '2023-02-23T10:00:00Z', got %q", ev.Start)
+	}
+	if ev.RRule != "RRULE:FREQ=DAILY;COUNT=5" {
+		t.Errorf("expected RRule 'RRULE:FREQ=DAILY;COUNT=5', got %q", ev.RRule)
+	}
+
+	// Without raw, recurrence lines aren't surfaced.
+	ev, err = convertVEvent(*vevent, false)
+	if err != nil {
+		t.Fatalf("convertVEvent returned error: %v", err)
+	}
+	if ev.RRule != "" {
+		t.Errorf("expected empty RRule when raw is false, got %q", ev.RRule)
+	}
+
+	if _, err := convertVEvent(*ical.NewEvent(), false); err == nil {
+		t.Error("expected an error for an event missing UID/DTSTART")
+	}
+}
+
+func TestConvertVEventCapturesTimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("America/New_York zoneinfo unavailable: %v", err)
+	}
+
+	vevent := ical.NewEvent()
+	vevent.Props.SetText(ical.PropUID, "event-1@example.com")
+	vevent.Props.SetDateTime(ical.PropDateTimeStart, time.Date(2024, 3, 8, 9, 0, 0, 0, loc))
+
+	ev, err := convertVEvent(*vevent, false)
+	if err != nil {
+		t.Fatalf("convertVEvent returned error: %v", err)
+	}
+	if ev.TimeZone != "America/New_York" {
+		t.Errorf("expected TimeZone 'America/New_York', got %q", ev.TimeZone)
+	}
+}
+
+func TestExpandCaldavMasters(t *testing.T) {
+	eq := eventQuery{
+		timeMin: mustParseRFC3339(t, "2023-03-01T00:00:00Z"),
+		timeMax: mustParseRFC3339(t, "2023-03-31T00:00:00Z"),
+	}
+	master := Event{
+		UID:   "series@example.com",
+		Title: "Standup",
+		Start: "2023-02-23T10:00:00Z",
+		End:   "2023-02-23T10:15:00Z",
+		RRule: "RRULE:FREQ=WEEKLY;COUNT=10",
+	}
+	override := Event{
+		UID:          "series@example.com",
+		Title:        "Standup (moved)",
+		Start:        "2023-03-09T11:00:00Z",
+		End:          "2023-03-09T11:15:00Z",
+		RecurrenceID: "2023-03-09T10:00:00Z",
+	}
+
+	res, err := expandCaldavMasters([]Event{master, override}, eq)
+	if err != nil {
+		t.Fatalf("expandCaldavMasters returned error: %v", err)
+	}
+
+	var sawOverride, sawOverriddenOccurrence bool
+	for _, ev := range res {
+		if ev.RRule != "" {
+			t.Errorf("expanded event %q still carries RRule %q", ev.RecurrenceID, ev.RRule)
+		}
+		if ev.Title == "Standup (moved)" {
+			sawOverride = true
+		}
+		if ev.RecurrenceID == "2023-03-09T10:00:00Z" && ev.Title == "Standup" {
+			sawOverriddenOccurrence = true
+		}
+	}
+	if !sawOverride {
+		t.Error("expected the override event to be included")
+	}
+	if sawOverriddenOccurrence {
+		t.Error("expected the overridden occurrence not to be duplicated from the master")
+	}
+}
+
+func TestExpandCaldavMastersAcrossDSTTransition(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("America/New_York zoneinfo unavailable: %v", err)
+	}
+
+	// 2024-03-10 is when America/New_York springs forward; a daily 9am
+	// local master must keep every occurrence at 9am local instead of
+	// drifting by an hour once the offset changes from -05:00 to -04:00.
+	eq := eventQuery{
+		timeMin: mustParseRFC3339(t, "2024-03-09T00:00:00Z"),
+		timeMax: mustParseRFC3339(t, "2024-03-13T00:00:00Z"),
+	}
+	master := Event{
+		UID:      "series@example.com",
+		Title:    "Standup",
+		Start:    time.Date(2024, 3, 8, 9, 0, 0, 0, loc).Format(time.RFC3339),
+		End:      time.Date(2024, 3, 8, 9, 15, 0, 0, loc).Format(time.RFC3339),
+		RRule:    "RRULE:FREQ=DAILY;COUNT=6",
+		TimeZone: "America/New_York",
+	}
+
+	res, err := expandCaldavMasters([]Event{master}, eq)
+	if err != nil {
+		t.Fatalf("expandCaldavMasters returned error: %v", err)
+	}
+	if len(res) == 0 {
+		t.Fatal("expected at least one occurrence within the window")
+	}
+	for _, ev := range res {
+		start, _, err := parseEventTime(ev.Start)
+		if err != nil {
+			t.Fatalf("parseEventTime(%q) returned error: %v", ev.Start, err)
+		}
+		if h, m, _ := start.In(loc).Clock(); h != 9 || m != 0 {
+			t.Errorf("expected occurrence %q to land at 09:00 local time, got %02d:%02d", ev.Start, h, m)
+		}
+	}
+}
+
+func TestFilterCaldavEvents(t *testing.T) {
+	events := []Event{
+		{Title: "Standup", Description: "Daily sync"},
+		{Title: "1:1 with manager", Description: "Career chat"},
+		{Title: "Standup archive", Description: ""},
+	}
+
+	got := filterCaldavEvents(events, eventQuery{q: "standup"})
+	if len(got) != 2 {
+		t.Errorf("expected 2 events matching %q, got %d", "standup", len(got))
+	}
+
+	got = filterCaldavEvents(events, eventQuery{maxResults: 2})
+	if len(got) != 2 {
+		t.Errorf("expected maxResults to cap results at 2, got %d", len(got))
+	}
+}
+
+func TestRecurrenceLinesFromProps(t *testing.T) {
+	props := ical.NewEvent().Props
+	props.Set(&ical.Prop{Name: ical.PropRecurrenceRule, Value: "FREQ=WEEKLY"})
+	props.Add(&ical.Prop{Name: ical.PropExceptionDates, Value: "20230301T090000Z"})
+	props.Add(&ical.Prop{Name: ical.PropExceptionDates, Value: "20230308T090000Z"})
+
+	got := recurrenceLinesFromProps(props)
+	want := strings.Join([]string{
+		"RRULE:FREQ=WEEKLY",
+		"EXDATE:20230301T090000Z",
+		"EXDATE:20230308T090000Z",
+	}, "\n")
+	if got != want {
+		t.Errorf("recurrenceLinesFromProps() = %q, want %q", got, want)
+	}
+}
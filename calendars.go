@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// calendarPalette is cycled through to assign each configured calendar a
+// distinct color, similar to Google Calendar's own per-calendar colors.
+var calendarPalette = []string{
+	"#7986cb", "#33b679", "#8e24aa", "#e67c73", "#f6bf26",
+	"#f4511e", "#039be5", "#616161", "#3f51b5", "#0b8043",
+}
+
+// calendarConfig holds the calendars this instance is configured to serve
+// (GCALJSON_GOOGLE_CALENDAR_ID or GCALJSON_CALDAV_CALENDARS, comma-separated)
+// and the color assigned to each one. It also acts as the allowlist: only
+// calendars listed here may be requested, so the service can't be used as an
+// open proxy onto arbitrary calendars the backend happens to have access to.
+type calendarConfig struct {
+	allowed []string
+	colors  map[string]string
+}
+
+// parseCalendarConfig parses a comma-separated calendar ID/path list into a
+// calendarConfig, assigning each calendar a color from calendarPalette in
+// configuration order.
+func parseCalendarConfig(raw string) calendarConfig {
+	cfg := calendarConfig{colors: make(map[string]string)}
+	for _, id := range strings.Split(raw, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		cfg.allowed = append(cfg.allowed, id)
+		cfg.colors[id] = calendarPalette[(len(cfg.allowed)-1)%len(calendarPalette)]
+	}
+	return cfg
+}
+
+// isAllowed reports whether id is one of the configured calendars.
+func (cfg calendarConfig) isAllowed(id string) bool {
+	for _, allowed := range cfg.allowed {
+		if allowed == id {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCalendarIDs determines which calendars a request targets: a path
+// parameter (/events/{calendarId}), a "calendars" query parameter
+// (/events?calendars=a,b,c), or — if neither is given — every configured
+// calendar. Any calendar outside the configured allowlist is rejected.
+func resolveCalendarIDs(r *http.Request, cfg calendarConfig) ([]string, error) {
+	if id := r.PathValue("calendarId"); id != "" {
+		if !cfg.isAllowed(id) {
+			return nil, fmt.Errorf("calendar %q is not in the configured allowlist", id)
+		}
+		return []string{id}, nil
+	}
+
+	if raw := r.URL.Query().Get("calendars"); raw != "" {
+		ids := strings.Split(raw, ",")
+		for i, id := range ids {
+			ids[i] = strings.TrimSpace(id)
+			if !cfg.isAllowed(ids[i]) {
+				return nil, fmt.Errorf("calendar %q is not in the configured allowlist", ids[i])
+			}
+		}
+		return ids, nil
+	}
+
+	return cfg.allowed, nil
+}
+
+// calendarConcurrency bounds how many calendars fetchEvents fans out to at
+// once. It's set from GCALJSON_CALENDAR_CONCURRENCY in main(), defaulting to
+// a small worker pool so a long allowlist can't overwhelm the Calendar API.
+var calendarConcurrency = 4
+
+// fetchEvents fans out to each calendar concurrently (bounded by
+// calendarConcurrency), merges the results and sorts them by start time.
+// Each calendar is fetched and cached independently by fetchCalendarEvents,
+// so a single slow or failing calendar doesn't invalidate the others: a
+// failure is logged and that calendar is omitted from the merged result,
+// and only if every calendar fails does fetchEvents itself return an error.
+func fetchEvents(ctx context.Context, provider EventProvider, calendarIDs []string, cfg calendarConfig, raw bool, eq eventQuery) ([]Event, error) {
+	type calendarResult struct {
+		events []Event
+		err    error
+	}
+
+	results := make([]calendarResult, len(calendarIDs))
+	sem := make(chan struct{}, calendarConcurrency)
+	var wg sync.WaitGroup
+	for i, calendarID := range calendarIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, calendarID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			events, err := fetchCalendarEvents(ctx, provider, calendarID, cfg.colors[calendarID], raw, eq)
+			results[i] = calendarResult{events: events, err: err}
+		}(i, calendarID)
+	}
+	wg.Wait()
+
+	var merged []Event
+	failures := 0
+	for _, res := range results {
+		if res.err != nil {
+			slog.Warn("fetchEvents: calendar fetch failed", "error", res.err)
+			failures++
+			continue
+		}
+		merged = append(merged, res.events...)
+	}
+	if failures > 0 && failures == len(calendarIDs) {
+		return nil, results[0].err
+	}
+	// Start is RFC3339 with each calendar's own UTC offset, so a plain string
+	// comparison sorts wrong across day boundaries once calendars in
+	// different time zones are merged; parse to time.Time and compare instants.
+	sort.Slice(merged, func(i, j int) bool {
+		ti, _, errI := parseEventTime(merged[i].Start)
+		tj, _, errJ := parseEventTime(merged[j].Start)
+		if errI != nil || errJ != nil {
+			return merged[i].Start < merged[j].Start
+		}
+		return ti.Before(tj)
+	})
+	return merged, nil
+}
+
+// fetchCalendarEvents は1つのカレンダーについて provider からイベントを取得し、
+// カレンダー・期間・検索条件ごとに独立したキーでキャッシュします。こうすることで、
+// ある問い合わせが遅延・失敗しても他の結果に影響しません。
+func fetchCalendarEvents(ctx context.Context, provider EventProvider, calendarID, color string, raw bool, eq eventQuery) ([]Event, error) {
+	cacheKey := eq.cacheKey(calendarID, raw)
+	if cached, found := eventCache.Get(cacheKey); found {
+		if events, ok := cached.([]Event); ok {
+			cacheHitsTotal.Inc()
+			return events, nil
+		}
+	}
+	cacheMissesTotal.Inc()
+
+	start := time.Now()
+	events, err := provider.List(ctx, calendarID, raw, eq)
+	providerCallDuration.WithLabelValues(activeProviderName).Observe(time.Since(start).Seconds())
+	if err != nil {
+		providerCallsTotal.WithLabelValues(activeProviderName, "error").Inc()
+		return nil, fmt.Errorf("calendar %q: %w", calendarID, err)
+	}
+	providerCallsTotal.WithLabelValues(activeProviderName, "ok").Inc()
+
+	res := make([]Event, len(events))
+	for i, ev := range events {
+		ev.CalendarID = calendarID
+		ev.Color = color
+		res[i] = ev
+	}
+	eventCache.Set(cacheKey, res, cache.DefaultExpiration)
+	return res, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// stubCalendarProvider is a minimal EventProvider stub for fetchEvents tests:
+// each calendar ID is wired to either a fixed error or a fixed event list.
+type stubCalendarProvider struct {
+	events map[string][]Event
+	errs   map[string]error
+}
+
+func (p *stubCalendarProvider) List(ctx context.Context, calendarID string, raw bool, eq eventQuery) ([]Event, error) {
+	if err, ok := p.errs[calendarID]; ok {
+		return nil, err
+	}
+	return p.events[calendarID], nil
+}
+
+func (p *stubCalendarProvider) HealthCheck(ctx context.Context, calendarID string) error {
+	return nil
+}
+
+func TestParseCalendarConfig(t *testing.T) {
+	cfg := parseCalendarConfig(" a@group.calendar.google.com , b@group.calendar.google.com ,,")
+	if len(cfg.allowed) != 2 {
+		t.Fatalf("Expected 2 calendars, got %d", len(cfg.allowed))
+	}
+	if !cfg.isAllowed("a@group.calendar.google.com") || !cfg.isAllowed("b@group.calendar.google.com") {
+		t.Error("Expected both configured calendars to be allowed")
+	}
+	if cfg.isAllowed("c@group.calendar.google.com") {
+		t.Error("Expected an unconfigured calendar to be rejected")
+	}
+	if cfg.colors["a@group.calendar.google.com"] == cfg.colors["b@group.calendar.google.com"] {
+		t.Error("Expected distinct calendars to get distinct colors")
+	}
+}
+
+func TestResolveCalendarIDs(t *testing.T) {
+	cfg := parseCalendarConfig("a@x.com,b@x.com")
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	ids, err := resolveCalendarIDs(req, cfg)
+	if err != nil {
+		t.Fatalf("resolveCalendarIDs returned error: %v", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("Expected all configured calendars by default, got %v", ids)
+	}
+
+	req = httptest.NewRequest("GET", "/events?calendars=b@x.com", nil)
+	ids, err = resolveCalendarIDs(req, cfg)
+	if err != nil {
+		t.Fatalf("resolveCalendarIDs returned error: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "b@x.com" {
+		t.Errorf("Expected [b@x.com], got %v", ids)
+	}
+
+	req = httptest.NewRequest("GET", "/events?calendars=evil@x.com", nil)
+	if _, err := resolveCalendarIDs(req, cfg); err == nil {
+		t.Error("Expected an error for a calendar outside the allowlist")
+	}
+}
+
+func TestFetchEventsMergesAndSortsAcrossTimeZones(t *testing.T) {
+	eventCache = cache.New(5*time.Minute, 10*time.Minute)
+	cfg := parseCalendarConfig("a@x.com,b@x.com")
+
+	// b's event is later in its own local clock time but, once the UTC
+	// offsets are accounted for, actually occurs before a's event.
+	provider := &stubCalendarProvider{events: map[string][]Event{
+		"a@x.com": {{Title: "a", Start: "2024-01-15T23:00:00-05:00"}},
+		"b@x.com": {{Title: "b", Start: "2024-01-16T07:00:00+09:00"}},
+	}}
+
+	events, err := fetchEvents(context.Background(), provider, []string{"a@x.com", "b@x.com"}, cfg, false, eventQuery{})
+	if err != nil {
+		t.Fatalf("fetchEvents returned error: %v", err)
+	}
+	if len(events) != 2 || events[0].Title != "b" || events[1].Title != "a" {
+		t.Errorf("Expected events sorted by instant ([b, a]), got %v", events)
+	}
+}
+
+func TestFetchEventsPartialFailureFallback(t *testing.T) {
+	eventCache = cache.New(5*time.Minute, 10*time.Minute)
+	cfg := parseCalendarConfig("ok@x.com,bad@x.com")
+
+	provider := &stubCalendarProvider{
+		events: map[string][]Event{"ok@x.com": {{Title: "fine", Start: "2024-01-15T09:00:00Z"}}},
+		errs:   map[string]error{"bad@x.com": errors.New("backend unavailable")},
+	}
+
+	events, err := fetchEvents(context.Background(), provider, []string{"ok@x.com", "bad@x.com"}, cfg, false, eventQuery{})
+	if err != nil {
+		t.Fatalf("Expected a single calendar failure not to fail the whole request, got: %v", err)
+	}
+	if len(events) != 1 || events[0].Title != "fine" {
+		t.Errorf("Expected only the healthy calendar's event, got %v", events)
+	}
+
+	if _, err := fetchEvents(context.Background(), provider, []string{"bad@x.com"}, cfg, false, eventQuery{}); err == nil {
+		t.Error("Expected an error when every configured calendar fails")
+	}
+}
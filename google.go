@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// googleProvider implements EventProvider against the Google Calendar API.
+type googleProvider struct {
+	srv *calendar.Service
+}
+
+// newGoogleProviderFromEnv builds a googleProvider and its calendarConfig
+// from GCALJSON_GOOGLE_CREDENTIAL (a base64-encoded service account JSON key)
+// and GCALJSON_GOOGLE_CALENDAR_ID (a comma-separated calendar allowlist).
+func newGoogleProviderFromEnv(ctx context.Context) (*googleProvider, calendarConfig, error) {
+	encodedCred := os.Getenv("GCALJSON_GOOGLE_CREDENTIAL")
+	calendarIDEnv := os.Getenv("GCALJSON_GOOGLE_CALENDAR_ID")
+	if encodedCred == "" || calendarIDEnv == "" {
+		return nil, calendarConfig{}, fmt.Errorf("GCALJSON_GOOGLE_CREDENTIAL と GCALJSON_GOOGLE_CALENDAR_ID を設定してください")
+	}
+
+	cfg := parseCalendarConfig(calendarIDEnv)
+	if len(cfg.allowed) == 0 {
+		return nil, calendarConfig{}, fmt.Errorf("GCALJSON_GOOGLE_CALENDAR_ID に有効なカレンダーIDを指定してください")
+	}
+
+	credJSON, err := base64.StdEncoding.DecodeString(encodedCred)
+	if err != nil {
+		return nil, calendarConfig{}, fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	srv, err := calendar.NewService(ctx, option.WithCredentialsJSON(credJSON))
+	if err != nil {
+		return nil, calendarConfig{}, fmt.Errorf("Google Calendar サービスの作成に失敗: %w", err)
+	}
+	return &googleProvider{srv: srv}, cfg, nil
+}
+
+// List implements EventProvider by calling Events.List, retrying transient
+// failures with retryWithBackoff. For raw requests it preserves RRULE/RDATE/
+// EXDATE on recurring master events and drops masters with no occurrence in
+// [eq.timeMin, eq.timeMax], since SingleEvents(false) doesn't filter parent
+// events by time range itself.
+func (p *googleProvider) List(ctx context.Context, calendarID string, raw bool, eq eventQuery) ([]Event, error) {
+	call := p.srv.Events.List(calendarID).
+		Context(ctx).
+		ShowDeleted(false).
+		SingleEvents(!raw).
+		TimeMin(eq.timeMin.Format(time.RFC3339)).
+		TimeMax(eq.timeMax.Format(time.RFC3339)).
+		OrderBy("startTime")
+	if eq.q != "" {
+		call = call.Q(eq.q)
+	}
+	if eq.maxResults > 0 {
+		call = call.MaxResults(eq.maxResults)
+	}
+
+	// 429/5xx や一時的なネットワークエラーは指数バックオフ＋ジッターで
+	// 再試行する。ctx がキャンセルされた場合（クライアント切断やシャット
+	// ダウン）は再試行を待たずに直ちに中断する。
+	var eventsResult *calendar.Events
+	err := retryWithBackoff(ctx, apiRetryConfig, func() error {
+		var doErr error
+		eventsResult, doErr = call.Do()
+		return doErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Event
+	for _, item := range eventsResult.Items {
+		if raw && len(item.Recurrence) > 0 {
+			start, _, err := parseEventTime(firstNonEmpty(item.Start.DateTime, item.Start.Date))
+			if err != nil {
+				return nil, fmt.Errorf("rrule: invalid start time for event %q: %w", item.Id, err)
+			}
+			start = inEventLocation(start, item.Start.TimeZone)
+			// Google は必ずしも timeMin/timeMax で親イベントを絞り込まないため、
+			// RRULE/RDATE/EXDATE を rrule-go で展開し、対象期間に発生が無い
+			// 親イベントは除外する。
+			occurrences, err := expandRecurrenceLines(start, item.Recurrence, eq.timeMin, eq.timeMax)
+			if err != nil {
+				return nil, err
+			}
+			if len(occurrences) == 0 {
+				continue
+			}
+		}
+		res = append(res, transformEvent(item))
+	}
+	return res, nil
+}
+
+// HealthCheck implements EventProvider by calling Calendars.Get, which
+// requires valid credentials but does no event listing work.
+func (p *googleProvider) HealthCheck(ctx context.Context, calendarID string) error {
+	_, err := p.srv.Calendars.Get(calendarID).Context(ctx).Do()
+	return err
+}
+
+// transformEvent は Google Calendar のイベントを GCalJSON 用の形式に変換します。
+// item.Recurrence が存在する場合（recurrence が raw のまま返された親イベント）は
+// RRULE/RDATE/EXDATE 行をそのまま RRule に保持し、iCal 出力で再利用できるようにします。
+func transformEvent(item *calendar.Event) Event {
+	start := item.Start.DateTime
+	if start == "" {
+		start = item.Start.Date
+	}
+	end := item.End.DateTime
+	if end == "" {
+		end = item.End.Date
+	}
+	// 繰り返しイベントの例外インスタンスは、親シリーズと同じ UID に
+	// RECURRENCE-ID を添えて区別するのが RFC 5545 の作法（RFC 5545 section
+	// 3.8.4.4）。item.Id は例外インスタンス固有の ID のため UID には使えない。
+	uid := item.Id
+	recurrenceID := ""
+	if item.RecurringEventId != "" {
+		uid = item.RecurringEventId
+		if item.OriginalStartTime != nil {
+			recurrenceID = item.OriginalStartTime.DateTime
+			if recurrenceID == "" {
+				recurrenceID = item.OriginalStartTime.Date
+			}
+		}
+	}
+	return Event{
+		Title:        item.Summary,
+		Start:        start,
+		End:          end,
+		Description:  item.Description,
+		Location:     item.Location,
+		UID:          uid,
+		Status:       item.Status,
+		RRule:        strings.Join(item.Recurrence, "\n"),
+		RecurrenceID: recurrenceID,
+		TimeZone:     item.Start.TimeZone,
+	}
+}
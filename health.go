@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout bounds how long /healthz waits for the backend
+// round-trip, so a hung calendar server can't make the readiness probe itself
+// hang past Kubernetes's own probe timeout.
+const healthCheckTimeout = 5 * time.Second
+
+// healthzHandler checks that the configured calendar backend is reachable
+// and its credentials are still valid, by running a lightweight request
+// against the first configured calendar. It's meant for a Kubernetes
+// readiness probe, to catch an expired service account or unreachable
+// CalDAV server before it causes user-facing request failures.
+func healthzHandler(provider EventProvider, cfg calendarConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(cfg.allowed) == 0 {
+			errorResponse(w, r, http.StatusServiceUnavailable, "No calendars configured", nil)
+			return
+		}
+		setCalendarIDs(r.Context(), cfg.allowed[:1])
+
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+		if err := provider.HealthCheck(ctx, cfg.allowed[0]); err != nil {
+			errorResponse(w, r, http.StatusServiceUnavailable, "Calendar backend health check failed", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeProvider is a minimal EventProvider stub for handler-level tests that
+// don't need a real calendar backend.
+type fakeProvider struct {
+	healthErr error
+}
+
+func (p *fakeProvider) List(ctx context.Context, calendarID string, raw bool, eq eventQuery) ([]Event, error) {
+	return nil, nil
+}
+
+func (p *fakeProvider) HealthCheck(ctx context.Context, calendarID string) error {
+	return p.healthErr
+}
+
+func TestHealthzHandler(t *testing.T) {
+	cfg := parseCalendarConfig("primary")
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	healthzHandler(&fakeProvider{}, cfg).ServeHTTP(rr, req)
+	if rr.Code != 200 {
+		t.Errorf("expected status 200 for a healthy provider, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	healthzHandler(&fakeProvider{healthErr: errors.New("credentials expired")}, cfg).ServeHTTP(rr, req)
+	if rr.Code != 503 {
+		t.Errorf("expected status 503 when HealthCheck fails, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	healthzHandler(&fakeProvider{}, calendarConfig{}).ServeHTTP(rr, req)
+	if rr.Code != 503 {
+		t.Errorf("expected status 503 when no calendars are configured, got %d", rr.Code)
+	}
+}
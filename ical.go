@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/teambition/rrule-go"
+)
+
+// icalContentType is the MIME type clients send via Accept to request an
+// RFC 5545 iCalendar response instead of JSON.
+const icalContentType = "text/calendar"
+
+// buildCalendar は Event のスライスを RFC 5545 準拠の VCALENDAR に変換します。
+// Thunderbird や Apple Calendar の購読、および Grafana の Business Calendar
+// Plugin から利用されることを想定しています。変換できないイベントが1件あっても
+// フィード全体を失わせないよう、そのイベントはログに記録した上でスキップします。
+func buildCalendar(events []Event) (*ical.Calendar, error) {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropProductID, "-//GCalJSON//EN")
+	cal.Props.SetText(ical.PropVersion, "2.0")
+
+	for _, e := range events {
+		vevent, err := e.toVEvent()
+		if err != nil {
+			slog.Warn("ical: skipping event", "title", e.Title, "error", err)
+			continue
+		}
+		cal.Children = append(cal.Children, vevent.Component)
+	}
+	return cal, nil
+}
+
+// toVEvent は Event を go-ical の VEVENT コンポーネントに変換します。
+func (e Event) toVEvent() (*ical.Event, error) {
+	start, allDay, err := parseEventTime(e.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time %q: %w", e.Start, err)
+	}
+	end, _, err := parseEventTime(e.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time %q: %w", e.End, err)
+	}
+	if !allDay {
+		start = inEventLocation(start, e.TimeZone)
+		end = inEventLocation(end, e.TimeZone)
+	}
+
+	vevent := ical.NewEvent()
+	uid := e.UID
+	if uid == "" {
+		uid = e.Start + "-" + e.Title
+	}
+	vevent.Props.SetText(ical.PropUID, uid)
+	vevent.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	vevent.Props.SetText(ical.PropSummary, e.Title)
+	if e.Description != "" {
+		vevent.Props.SetText(ical.PropDescription, e.Description)
+	}
+	if e.Location != "" {
+		vevent.Props.SetText(ical.PropLocation, e.Location)
+	}
+	if e.Status != "" {
+		vevent.Props.SetText(ical.PropStatus, strings.ToUpper(e.Status))
+	}
+	setDateProp(vevent.Props, ical.PropDateTimeStart, start, allDay)
+	setDateProp(vevent.Props, ical.PropDateTimeEnd, end, allDay)
+
+	if e.RecurrenceID != "" {
+		recurrenceID, _, err := parseEventTime(e.RecurrenceID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recurrence id %q: %w", e.RecurrenceID, err)
+		}
+		setDateProp(vevent.Props, ical.PropRecurrenceID, recurrenceID, allDay)
+	}
+	if e.RRule != "" {
+		if err := applyRecurrenceLines(vevent.Props, e.RRule, start.Location(), allDay); err != nil {
+			return nil, err
+		}
+	}
+	return vevent, nil
+}
+
+// applyRecurrenceLines は Google Calendar の item.Recurrence をそのまま連結した
+// Event.RRule（RRULE/EXDATE/RDATE が改行区切りで混在し得る）を、go-ical の
+// RRULE/EXDATE/RDATE プロパティとして vevent に反映します。
+// rrule.StrToROptionInLocation は RRULE 行しか受け付けないため、行ごとに
+// プロパティ名で振り分けて処理します。
+func applyRecurrenceLines(props ical.Props, rawLines string, loc *time.Location, allDay bool) error {
+	for _, line := range strings.Split(rawLines, "\n") {
+		name, value, ok := splitRecurrenceLine(line)
+		if !ok {
+			continue
+		}
+		switch name {
+		case "RRULE":
+			roption, err := rrule.StrToROptionInLocation(value, loc)
+			if err != nil {
+				return fmt.Errorf("invalid RRULE %q: %w", line, err)
+			}
+			props.SetRecurrenceRule(roption)
+		case "EXDATE":
+			dates, err := rrule.StrToDatesInLoc(value, loc)
+			if err != nil {
+				return fmt.Errorf("invalid EXDATE %q: %w", line, err)
+			}
+			for _, d := range dates {
+				addDateProp(props, ical.PropExceptionDates, d, allDay)
+			}
+		case "RDATE":
+			dates, err := rrule.StrToDatesInLoc(value, loc)
+			if err != nil {
+				return fmt.Errorf("invalid RDATE %q: %w", line, err)
+			}
+			for _, d := range dates {
+				addDateProp(props, ical.PropRecurrenceDates, d, allDay)
+			}
+		}
+	}
+	return nil
+}
+
+// splitRecurrenceLine は "RRULE:FREQ=..." や "EXDATE;TZID=...:..." のような
+// 行をプロパティ名と値に分割します。
+func splitRecurrenceLine(line string) (name, value string, ok bool) {
+	nameEnd := strings.IndexAny(line, ";:")
+	colon := strings.IndexByte(line, ':')
+	if nameEnd <= 0 || colon < 0 {
+		return "", "", false
+	}
+	return strings.ToUpper(line[:nameEnd]), line[colon+1:], true
+}
+
+// parseEventTime は transformEvent が生成する文字列（RFC3339、もしくは終日
+// イベントの場合は "2006-01-02" の日付のみ）を time.Time に戻します。
+func parseEventTime(s string) (t time.Time, allDay bool, err error) {
+	if t, err = time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	if t, err = time.Parse("2006-01-02", s); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("unrecognized time format %q", s)
+}
+
+// inEventLocation rebinds t to tzid's real IANA zone, if tzid is non-empty
+// and recognized, preserving t's wall-clock reading (year/month/day/hour/
+// minute/second) rather than converting its instant. t from parseEventTime
+// always carries a fixed UTC offset — the literal "+HH:MM"/"Z" its RFC3339
+// source string encoded — which has no DST rules of its own, so recurrence
+// expansion against it drifts by an hour across a DST transition. The
+// backend's DateTime is already expressed in the event's own local civil
+// time, so re-stamping the same wall-clock fields onto the named zone (not
+// t.In, which would shift the clock to match the same instant) recovers
+// that. Falls back to t unchanged if tzid is empty or unrecognized.
+func inEventLocation(t time.Time, tzid string) time.Time {
+	if tzid == "" {
+		return t
+	}
+	loc, err := time.LoadLocation(tzid)
+	if err != nil {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// formatEventTime は parseEventTime の逆変換です。allDay なら "2006-01-02" の
+// 日付のみ、それ以外は RFC3339 の文字列を返します。
+func formatEventTime(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
+// setDateProp は allDay に応じて DATE もしくは DATE-TIME 値として prop を設定します。
+// 既存の同名プロパティは上書きされます。
+func setDateProp(props ical.Props, name string, t time.Time, allDay bool) {
+	prop := ical.NewProp(name)
+	if allDay {
+		prop.SetDate(t)
+	} else {
+		prop.SetDateTime(t)
+	}
+	props.Set(prop)
+}
+
+// addDateProp は setDateProp と同様ですが、EXDATE/RDATE のように同名プロパティを
+// 複数持ちうる場合に追加（上書きしない）します。
+func addDateProp(props ical.Props, name string, t time.Time, allDay bool) {
+	prop := ical.NewProp(name)
+	if allDay {
+		prop.SetDate(t)
+	} else {
+		prop.SetDateTime(t)
+	}
+	props.Add(prop)
+}
+
+// expandRecurrenceLines は RRULE/RDATE/EXDATE 行（RFC 5545 形式、起点は start）を
+// rrule-go で展開し、[windowMin, windowMax] に収まる発生日時を返します。
+// Google Calendar・CalDAV のいずれも timeMin/timeMax だけでは親イベント自体を
+// 除外してくれないため、raw モードで取得した繰り返しイベントが実際に対象期間内に
+// 発生を持つかどうかの判定に使います（CalDAV の場合は個々の発生時刻そのものの
+// 算出にも使われます）。DTSTART は start.Location() のローカル時刻（Z を付けない
+// LocalDateTimeFormat）で渡す必要があります。rrule-go の strToTimeInLoc は
+// "...Z" 付きの値を渡された loc に関わらず常に UTC として解釈するため、Z 付きで
+// 渡すと夏時間の境界を跨ぐ繰り返しのローカル時刻がずれてしまいます。
+//
+// start.Location() must be a real IANA zone (via inEventLocation), not the
+// fixed UTC offset time.Parse(time.RFC3339, ...) produces, or occurrences on
+// the far side of a DST transition will carry the wrong offset: rrule-go
+// advances the wall-clock fields and re-resolves each occurrence's offset
+// against start's Location, and a fixed-offset Location has no DST rules to
+// re-resolve against.
+func expandRecurrenceLines(start time.Time, lines []string, windowMin, windowMax time.Time) ([]time.Time, error) {
+	full := make([]string, 0, len(lines)+1)
+	full = append(full, "DTSTART:"+start.Format(rrule.LocalDateTimeFormat))
+	full = append(full, lines...)
+
+	set, err := rrule.StrSliceToRRuleSetInLoc(full, start.Location())
+	if err != nil {
+		return nil, fmt.Errorf("rrule: failed to parse recurrence: %w", err)
+	}
+	return set.Between(windowMin, windowMax, true), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventToVEvent(t *testing.T) {
+	ev := Event{
+		Title:       "Test Event",
+		Start:       "2023-02-23T10:00:00Z",
+		End:         "2023-02-23T11:00:00Z",
+		Description: "Test Description",
+		Location:    "Test Location",
+		UID:         "abc123@google.com",
+		Status:      "confirmed",
+		RRule:       "RRULE:FREQ=WEEKLY;COUNT=3",
+	}
+
+	vevent, err := ev.toVEvent()
+	if err != nil {
+		t.Fatalf("toVEvent returned error: %v", err)
+	}
+
+	if uid, err := vevent.Props.Text("UID"); err != nil || uid != ev.UID {
+		t.Errorf("Expected UID %q, got %q (err=%v)", ev.UID, uid, err)
+	}
+	if summary, err := vevent.Props.Text("SUMMARY"); err != nil || summary != ev.Title {
+		t.Errorf("Expected SUMMARY %q, got %q (err=%v)", ev.Title, summary, err)
+	}
+	if status, err := vevent.Props.Text("STATUS"); err != nil || status != "CONFIRMED" {
+		t.Errorf("Expected STATUS 'CONFIRMED', got %q (err=%v)", status, err)
+	}
+	if roption, err := vevent.Props.RecurrenceRule(); err != nil || roption == nil {
+		t.Errorf("Expected a recurrence rule, got %v (err=%v)", roption, err)
+	}
+}
+
+func TestEventToVEventWithExceptionDates(t *testing.T) {
+	ev := Event{
+		Title: "Weekly Sync",
+		Start: "2023-02-23T10:00:00Z",
+		End:   "2023-02-23T11:00:00Z",
+		UID:   "series@google.com",
+		RRule: "RRULE:FREQ=WEEKLY;COUNT=5\nEXDATE:20230302T100000Z",
+	}
+
+	vevent, err := ev.toVEvent()
+	if err != nil {
+		t.Fatalf("toVEvent returned error: %v", err)
+	}
+	if roption, err := vevent.Props.RecurrenceRule(); err != nil || roption == nil {
+		t.Errorf("Expected a recurrence rule, got %v (err=%v)", roption, err)
+	}
+	if exdates := vevent.Props.Values("EXDATE"); len(exdates) != 1 {
+		t.Errorf("Expected 1 EXDATE prop, got %d", len(exdates))
+	}
+}
+
+func TestParseEventTime(t *testing.T) {
+	if _, allDay, err := parseEventTime("2023-02-23T10:00:00Z"); err != nil || allDay {
+		t.Errorf("Expected timed event, got allDay=%v err=%v", allDay, err)
+	}
+	if _, allDay, err := parseEventTime("2023-02-23"); err != nil || !allDay {
+		t.Errorf("Expected all-day event, got allDay=%v err=%v", allDay, err)
+	}
+	if _, _, err := parseEventTime("not-a-time"); err == nil {
+		t.Error("Expected an error for an unrecognized time format")
+	}
+}
+
+func TestExpandRecurrenceLines(t *testing.T) {
+	start := time.Date(2023, 2, 1, 9, 0, 0, 0, time.UTC)
+	windowMin := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	windowMax := time.Date(2023, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	occurrences, err := expandRecurrenceLines(start, []string{"RRULE:FREQ=WEEKLY;COUNT=10"}, windowMin, windowMax)
+	if err != nil {
+		t.Fatalf("expandRecurrenceLines returned error: %v", err)
+	}
+	if len(occurrences) == 0 {
+		t.Error("Expected at least one occurrence within the window")
+	}
+	for _, occ := range occurrences {
+		if occ.Before(windowMin) || occ.After(windowMax) {
+			t.Errorf("Occurrence %v outside window [%v, %v]", occ, windowMin, windowMax)
+		}
+	}
+
+	outOfRangeStart := time.Date(2023, 1, 1, 9, 0, 0, 0, time.UTC)
+	occurrences, err = expandRecurrenceLines(outOfRangeStart, []string{"RRULE:FREQ=WEEKLY;COUNT=2"}, windowMin, windowMax)
+	if err != nil {
+		t.Fatalf("expandRecurrenceLines returned error: %v", err)
+	}
+	if len(occurrences) != 0 {
+		t.Errorf("Expected no occurrences within the window, got %d", len(occurrences))
+	}
+}
+
+func TestInEventLocation(t *testing.T) {
+	fixedOffset := time.Date(2024, 1, 15, 9, 0, 0, 0, time.FixedZone("", -5*60*60))
+	localized := inEventLocation(fixedOffset, "America/New_York")
+	if localized.Location().String() != "America/New_York" {
+		t.Errorf("Expected America/New_York, got %v", localized.Location())
+	}
+	if h, m, s := localized.Clock(); h != 9 || m != 0 || s != 0 {
+		t.Errorf("Expected the wall clock reading to be preserved (09:00:00), got %02d:%02d:%02d", h, m, s)
+	}
+	if y, mo, d := localized.Date(); y != 2024 || mo != time.January || d != 15 {
+		t.Errorf("Expected the date to be preserved, got %v-%v-%v", y, mo, d)
+	}
+
+	unchanged := inEventLocation(fixedOffset, "")
+	if !unchanged.Equal(fixedOffset) || unchanged.Location() != fixedOffset.Location() {
+		t.Error("Expected inEventLocation to return t unchanged for an empty tzid")
+	}
+
+	unresolved := inEventLocation(fixedOffset, "Not/A_Zone")
+	if !unresolved.Equal(fixedOffset) || unresolved.Location() != fixedOffset.Location() {
+		t.Error("Expected inEventLocation to return t unchanged for an unrecognized tzid")
+	}
+}
+
+func TestExpandRecurrenceLinesAcrossDSTTransition(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("America/New_York zoneinfo unavailable: %v", err)
+	}
+
+	// 2024-03-10 is when America/New_York springs forward; a daily 9am local
+	// recurrence must stay at 9am local (UTC-5 before, UTC-4 after), not
+	// drift by an hour the way a fixed-offset Location would.
+	start := time.Date(2024, 3, 8, 9, 0, 0, 0, loc)
+	windowMin := time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)
+	windowMax := time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)
+
+	occurrences, err := expandRecurrenceLines(start, []string{"RRULE:FREQ=DAILY;COUNT=6"}, windowMin, windowMax)
+	if err != nil {
+		t.Fatalf("expandRecurrenceLines returned error: %v", err)
+	}
+	if len(occurrences) == 0 {
+		t.Fatal("Expected at least one occurrence within the window")
+	}
+	for _, occ := range occurrences {
+		if h, m, _ := occ.In(loc).Clock(); h != 9 || m != 0 {
+			t.Errorf("Expected every occurrence to land at 09:00 local time across the DST transition, got %02d:%02d on %v", h, m, occ)
+		}
+	}
+}
+
+func TestWantsICal(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events.ics", nil)
+	if !wantsICal(req) {
+		t.Error("Expected wantsICal to be true for .ics path")
+	}
+
+	req = httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Accept", icalContentType)
+	if !wantsICal(req) {
+		t.Error("Expected wantsICal to be true for Accept: text/calendar")
+	}
+
+	req = httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Accept", "application/json")
+	if wantsICal(req) {
+		t.Error("Expected wantsICal to be false for Accept: application/json")
+	}
+}
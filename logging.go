@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// requestIDKey is the context key under which withObservability stores each
+// request's ID, so errorResponse can include it in its own log line.
+type requestIDKey struct{}
+
+// calendarIDsKey is the context key under which withObservability stores a
+// pointer to the resolved calendar IDs, so getEventsHandler can report them
+// back via setCalendarIDs for the request's log line once it knows them. A
+// pointer is needed (rather than a value, like requestIDKey) because the IDs
+// aren't known until after next() has started running, by which point
+// r.WithContext would only rebind the inner handler's local copy of the request.
+type calendarIDsKey struct{}
+
+// setCalendarIDs records the resolved calendar IDs for the current request,
+// for withObservability to log once the handler returns. It's a no-op if ctx
+// wasn't produced by withObservability (e.g. in tests that call a handler
+// directly), since there's then nowhere to store them.
+func setCalendarIDs(ctx context.Context, ids []string) {
+	if ptr, ok := ctx.Value(calendarIDsKey{}).(*[]string); ok {
+		*ptr = ids
+	}
+}
+
+// requestIDCounter hands out a monotonically increasing ID per request. A
+// counter (rather than a random value) keeps request IDs short and avoids
+// pulling in crypto/rand for something that's only ever used to correlate
+// log lines from a single process's lifetime.
+var requestIDCounter atomic.Uint64
+
+func nextRequestID() string {
+	return strconv.FormatUint(requestIDCounter.Add(1), 36)
+}
+
+// requestIDFromContext returns the request ID stored by withObservability,
+// or "" if ctx carries none (e.g. in tests that call a handler directly).
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// statusRecorder wraps a ResponseWriter to capture the status code written,
+// since http.ResponseWriter itself doesn't expose it after the fact.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withObservability wraps next with structured request logging and
+// Prometheus HTTP metrics. route is the registered mux pattern (e.g. "GET
+// /events/{calendarId}"), used as a low-cardinality label and log field in
+// place of the raw, potentially parameterized request path.
+func withObservability(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := nextRequestID()
+		calendarIDs := new([]string)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+		ctx = context.WithValue(ctx, calendarIDsKey{}, calendarIDs)
+		r = r.WithContext(ctx)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next(rec, r)
+		duration := time.Since(start)
+
+		status := strconv.Itoa(rec.status)
+		httpRequestsTotal.WithLabelValues(route, r.Method, status).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method).Observe(duration.Seconds())
+
+		slog.Info("http request",
+			"request_id", requestID,
+			"remote_addr", r.RemoteAddr,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", rec.status,
+			"duration_ms", duration.Milliseconds(),
+			"calendar_id", strings.Join(*calendarIDs, ","),
+		)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNextRequestIDIncrements(t *testing.T) {
+	a := nextRequestID()
+	b := nextRequestID()
+	if a == b {
+		t.Errorf("expected nextRequestID to return distinct values, got %q twice", a)
+	}
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events", nil)
+	if got := requestIDFromContext(req.Context()); got != "" {
+		t.Errorf("expected empty request ID for a context with none set, got %q", got)
+	}
+}
+
+func TestWithObservabilitySetsStatusAndRequestID(t *testing.T) {
+	var seenRequestID string
+	handler := withObservability("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		seenRequestID = requestIDFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/events", nil))
+
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("expected status %d, got %d", http.StatusTeapot, rr.Code)
+	}
+	if seenRequestID == "" {
+		t.Error("expected withObservability to set a non-empty request ID in the handler's context")
+	}
+}
+
+func TestSetCalendarIDs(t *testing.T) {
+	ids := new([]string)
+	ctx := context.WithValue(context.Background(), calendarIDsKey{}, ids)
+
+	setCalendarIDs(ctx, []string{"a@x.com", "b@x.com"})
+	if len(*ids) != 2 || (*ids)[0] != "a@x.com" || (*ids)[1] != "b@x.com" {
+		t.Errorf("expected setCalendarIDs to populate the context's pointer, got %v", *ids)
+	}
+}
+
+func TestSetCalendarIDsWithoutContextIsNoop(t *testing.T) {
+	setCalendarIDs(context.Background(), []string{"a@x.com"})
+}
+
+func TestWithObservabilityRecordsResolvedCalendarIDs(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+
+	handler := withObservability("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		setCalendarIDs(r.Context(), []string{"a@x.com", "b@x.com"})
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events?calendars=a@x.com,b@x.com", nil))
+
+	var logLine map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &logLine); err != nil {
+		t.Fatalf("failed to decode log line: %v", err)
+	}
+	if logLine["calendar_id"] != "a@x.com,b@x.com" {
+		t.Errorf("expected calendar_id %q, got %q", "a@x.com,b@x.com", logLine["calendar_id"])
+	}
+}
@@ -2,18 +2,19 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/emersion/go-ical"
 	"github.com/patrickmn/go-cache"
-	"google.golang.org/api/calendar/v3"
-	"google.golang.org/api/option"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // GCalJSON API - Swagger documentation
@@ -26,47 +27,31 @@ import (
 // @BasePath /
 
 type Event struct {
-	Title       string `json:"title"`
-	Start       string `json:"start"`
-	End         string `json:"end"`
-	Description string `json:"description,omitempty"`
-	Location    string `json:"location,omitempty"`
+	Title        string `json:"title"`
+	Start        string `json:"start"`
+	End          string `json:"end"`
+	Description  string `json:"description,omitempty"`
+	Location     string `json:"location,omitempty"`
+	UID          string `json:"uid,omitempty"`
+	Status       string `json:"status,omitempty"`
+	RRule        string `json:"rrule,omitempty"`
+	RecurrenceID string `json:"recurrenceId,omitempty"`
+	CalendarID   string `json:"calendarId,omitempty"`
+	Color        string `json:"color,omitempty"`
+	// TimeZone is the IANA zone name (e.g. "America/New_York") Start/End were
+	// expressed in at the source, when the backend reports one. RRule
+	// expansion uses it to compute occurrences against the real DST rules of
+	// that zone instead of Start's fixed UTC offset, which would otherwise
+	// drift by an hour across a DST transition.
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
-// eventCache は Google Calendar API の結果をキャッシュします。
+// eventCache は各バックエンド（Google Calendar / CalDAV）の結果をキャッシュします。
 // キャッシュ期間は環境変数 GCALJSON_CACHE_DURATION (例:"5m") から設定します。
 var eventCache *cache.Cache
 
-// transformEvent は Google Calendar のイベントを GCalJSON 用の形式に変換します。
-func transformEvent(item *calendar.Event) Event {
-	start := item.Start.DateTime
-	if start == "" {
-		start = item.Start.Date
-	}
-	end := item.End.DateTime
-	if end == "" {
-		end = item.End.Date
-	}
-	return Event{
-		Title:       item.Summary,
-		Start:       start,
-		End:         end,
-		Description: item.Description,
-		Location:    item.Location,
-	}
-}
-
-// fetchEvents は Google Calendar API からイベントを取得し、キャッシュします。
-func fetchEvents(srv *calendar.Service, calendarID string) ([]Event, error) {
-	const cacheKey = "events"
-	if cached, found := eventCache.Get(cacheKey); found {
-		if events, ok := cached.([]Event); ok {
-			return events, nil
-		}
-	}
-
-	nowTime := time.Now()
-
+// defaultWindow は「前月の初日」から「来月の最終日」までの既定のクエリ期間を返します。
+func defaultWindow(nowTime time.Time) (time.Time, time.Time) {
 	// 前月の初日を計算
 	var prevMonth time.Month
 	var prevYear int
@@ -84,91 +69,202 @@ func fetchEvents(srv *calendar.Service, calendarID string) ([]Event, error) {
 	tMaxBase := time.Date(nowTime.Year(), nowTime.Month()+2, 1, 0, 0, 0, 0, nowTime.Location())
 	tMaxTime := tMaxBase.Add(-time.Second)
 
-	timeMin := tMinTime.Format(time.RFC3339)
-	timeMax := tMaxTime.Format(time.RFC3339)
-
-	eventsResult, err := srv.Events.List(calendarID).
-		ShowDeleted(false).
-		SingleEvents(true).
-		TimeMin(timeMin).
-		TimeMax(timeMax).
-		OrderBy("startTime").
-		Do()
-	if err != nil {
-		return nil, err
-	}
-
-	var res []Event
-	for _, item := range eventsResult.Items {
-		res = append(res, transformEvent(item))
-	}
-	eventCache.Set(cacheKey, res, cache.DefaultExpiration)
-	return res, nil
+	return tMinTime, tMaxTime
 }
 
-// errorResponse は詳細なエラーメッセージをログ出力しつつ、JSON レスポンスを返します。
-func errorResponse(w http.ResponseWriter, code int, message string, err error) {
-	log.Printf("Error: %s: %v", message, err)
+// errorResponse は詳細なエラーメッセージを構造化ログとして出力しつつ、JSON
+// レスポンスを返します。r から request_id（withObservability が設定）・
+// remote_addr・method・path を取り出し、ログから元のリクエストを追跡できる
+// ようにします。
+func errorResponse(w http.ResponseWriter, r *http.Request, code int, message string, err error) {
+	slog.Error(message,
+		"error", err,
+		"request_id", requestIDFromContext(r.Context()),
+		"remote_addr", r.RemoteAddr,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", code,
+	)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
 
-// getEventsHandler は /events エンドポイントのハンドラです。
+// wantsICal は Accept ヘッダーまたはリクエストパスから iCalendar 形式が
+// 要求されているかどうかを判定します。
+func wantsICal(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, ".ics") || strings.Contains(r.Header.Get("Accept"), icalContentType)
+}
+
+// getEventsHandler は /events, /events.ics, /events/{calendarId} エンドポイントの
+// ハンドラです。対象カレンダーは resolveCalendarIDs がパスパラメータ、"calendars"
+// クエリパラメータ、もしくは設定済みの全カレンダーから決定します。クエリ期間・検索
+// 語・件数上限は parseEventQuery が timeMin/timeMax/q/maxResults から決定し、
+// maxWindow を超える期間は 400 で拒否します。Accept: text/calendar、もしくは .ics
+// 拡張子が指定された場合は RRULE を保持した VCALENDAR を返し、それ以外は従来どおり
+// 展開済みの JSON を返します。provider は GCALJSON_PROVIDER で選択された
+// EventProvider（Google Calendar もしくは CalDAV）です。
 // @Summary Get calendar events
-// @Description Google Calendar からイベントを取得し、Grafana のBusiness Calendar Plugin 用の形式で返します。
+// @Description Google Calendar もしくは CalDAV からイベントを取得し、Grafana のBusiness Calendar Plugin 用の形式、もしくは iCalendar 形式で返します。
 // @Tags events
 // @Accept json
 // @Produce json
+// @Produce text/calendar
+// @Param calendarId path string false "Calendar ID"
+// @Param calendars query string false "Comma-separated calendar IDs"
+// @Param timeMin query string false "RFC3339 timestamp or relative offset, e.g. -30d"
+// @Param timeMax query string false "RFC3339 timestamp or relative offset, e.g. +90d"
+// @Param q query string false "Full-text search"
+// @Param maxResults query int false "Maximum number of events to return"
 // @Success 200 {array} Event
+// @Failure 400 {object} map[string]string "error message"
 // @Failure 500 {object} map[string]string "error message"
 // @Router /events [get]
-func getEventsHandler(srv *calendar.Service, calendarID string) http.HandlerFunc {
+func getEventsHandler(provider EventProvider, cfg calendarConfig, maxWindow time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		events, err := fetchEvents(srv, calendarID)
+		calendarIDs, err := resolveCalendarIDs(r, cfg)
+		if err != nil {
+			errorResponse(w, r, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		setCalendarIDs(r.Context(), calendarIDs)
+		eq, err := parseEventQuery(r, maxWindow)
+		if err != nil {
+			errorResponse(w, r, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+
+		if wantsICal(r) {
+			events, err := fetchEvents(r.Context(), provider, calendarIDs, cfg, true, eq)
+			if err != nil {
+				errorResponse(w, r, http.StatusInternalServerError, "Failed to fetch events", err)
+				return
+			}
+			cal, err := buildCalendar(events)
+			if err != nil {
+				errorResponse(w, r, http.StatusInternalServerError, "Failed to build calendar", err)
+				return
+			}
+			w.Header().Set("Content-Type", icalContentType+"; charset=utf-8")
+			if err := ical.NewEncoder(w).Encode(cal); err != nil {
+				errorResponse(w, r, http.StatusInternalServerError, "Failed to encode calendar", err)
+			}
+			return
+		}
+
+		events, err := fetchEvents(r.Context(), provider, calendarIDs, cfg, false, eq)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, "Failed to fetch events", err)
+			errorResponse(w, r, http.StatusInternalServerError, "Failed to fetch events", err)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(events); err != nil {
-			errorResponse(w, http.StatusInternalServerError, "Failed to encode response", err)
+			errorResponse(w, r, http.StatusInternalServerError, "Failed to encode response", err)
 		}
 	}
 }
 
+// fatal logs msg as a structured error (matching every other log line this
+// process emits) and exits, taking the place of log.Fatal now that slog has
+// replaced the standard logger.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
 func main() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
 	// 環境変数は接頭辞 GCALJSON_ を利用
-	// Base64エンコードされた認証情報をデコードして使用する
-	encodedCred := os.Getenv("GCALJSON_GOOGLE_CREDENTIAL")
-	calendarID := os.Getenv("GCALJSON_GOOGLE_CALENDAR_ID")
-	cacheDurationStr := os.Getenv("GCALJSON_CACHE_DURATION")
-	if encodedCred == "" || calendarID == "" {
-		log.Fatal("GCALJSON_GOOGLE_CREDENTIAL と GCALJSON_GOOGLE_CALENDAR_ID を設定してください")
+	ctx := context.Background()
+
+	// GCALJSON_PROVIDER でバックエンドを選択する（既定は google）。
+	// バックエンドごとの認証情報・カレンダー一覧は provider 固有の環境変数
+	// （GCALJSON_GOOGLE_*／GCALJSON_CALDAV_*）から読み込む。
+	providerName := os.Getenv("GCALJSON_PROVIDER")
+	if providerName == "" {
+		providerName = "google"
+	}
+	var (
+		provider EventProvider
+		cfg      calendarConfig
+		err      error
+	)
+	switch providerName {
+	case "google":
+		provider, cfg, err = newGoogleProviderFromEnv(ctx)
+	case "caldav":
+		provider, cfg, err = newCaldavProviderFromEnv()
+	default:
+		fatal("Unknown GCALJSON_PROVIDER", "provider", providerName)
 	}
+	if err != nil {
+		fatal("failed to initialize calendar provider", "error", err)
+	}
+	activeProviderName = providerName
+
+	cacheDurationStr := os.Getenv("GCALJSON_CACHE_DURATION")
 	if cacheDurationStr == "" {
 		cacheDurationStr = "5m"
 	}
 	cacheDuration, err := time.ParseDuration(cacheDurationStr)
 	if err != nil {
-		log.Fatalf("Invalid GCALJSON_CACHE_DURATION: %v", err)
+		fatal("Invalid GCALJSON_CACHE_DURATION", "error", err)
 	}
 	// キャッシュの有効期間は環境変数から設定（クリーニング間隔は2倍の期間）
 	eventCache = cache.New(cacheDuration, 2*cacheDuration)
+	registerCachedEventsGauge()
 
-	credJSON, err := base64.StdEncoding.DecodeString(encodedCred)
-	if err != nil {
-		log.Fatalf("Failed to decode credentials: %v", err)
+	if concurrencyStr := os.Getenv("GCALJSON_CALENDAR_CONCURRENCY"); concurrencyStr != "" {
+		n, err := strconv.Atoi(concurrencyStr)
+		if err != nil || n <= 0 {
+			fatal("Invalid GCALJSON_CALENDAR_CONCURRENCY", "value", concurrencyStr)
+		}
+		calendarConcurrency = n
 	}
 
-	ctx := context.Background()
-	srv, err := calendar.NewService(ctx, option.WithCredentialsJSON(credJSON))
-	if err != nil {
-		log.Fatalf("Google Calendar サービスの作成に失敗: %v", err)
+	// Calendar API 呼び出しの再試行回数・待機時間は環境変数から上書きできる。
+	if v := os.Getenv("GCALJSON_RETRY_MAX"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fatal("Invalid GCALJSON_RETRY_MAX", "value", v)
+		}
+		apiRetryConfig.maxAttempts = n
+	}
+	if v := os.Getenv("GCALJSON_RETRY_MIN_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("Invalid GCALJSON_RETRY_MIN_DELAY", "value", v)
+		}
+		apiRetryConfig.minDelay = d
+	}
+	if v := os.Getenv("GCALJSON_RETRY_MAX_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("Invalid GCALJSON_RETRY_MAX_DELAY", "value", v)
+		}
+		apiRetryConfig.maxDelay = d
+	}
+	if apiRetryConfig.maxDelay < apiRetryConfig.minDelay {
+		fatal("GCALJSON_RETRY_MAX_DELAY must not be smaller than GCALJSON_RETRY_MIN_DELAY")
+	}
+
+	// 1リクエストが問い合わせられる期間の上限。既定は365日。
+	maxWindow := 365 * 24 * time.Hour
+	if v := os.Getenv("GCALJSON_MAX_WINDOW"); v != "" {
+		d, err := parseSpan(v)
+		if err != nil {
+			fatal("Invalid GCALJSON_MAX_WINDOW", "error", err)
+		}
+		maxWindow = d
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/events", getEventsHandler(srv, calendarID))
+	mux.HandleFunc("GET /events", withObservability("GET /events", getEventsHandler(provider, cfg, maxWindow)))
+	mux.HandleFunc("GET /events.ics", withObservability("GET /events.ics", getEventsHandler(provider, cfg, maxWindow)))
+	mux.HandleFunc("GET /events/{calendarId}", withObservability("GET /events/{calendarId}", getEventsHandler(provider, cfg, maxWindow)))
+	mux.HandleFunc("GET /healthz", withObservability("GET /healthz", healthzHandler(provider, cfg)))
+	mux.Handle("GET /metrics", promhttp.Handler())
 
 	server := &http.Server{
 		Addr:    ":8080",
@@ -177,9 +273,9 @@ func main() {
 
 	// サーバーをゴルーチンで起動
 	go func() {
-		log.Println("GCalJSON API server started on :8080")
+		slog.Info("GCalJSON API server started", "addr", ":8080")
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+			fatal("Server error", "error", err)
 		}
 	}()
 
@@ -187,12 +283,12 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
 
 	ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctxShutdown); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", "error", err)
 	}
-	log.Println("Server exiting")
+	slog.Info("server exiting")
 }
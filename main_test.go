@@ -75,7 +75,8 @@ func TestTransformEvent(t *testing.T) {
 
 func TestErrorResponse(t *testing.T) {
 	rr := httptest.NewRecorder()
-	errorResponse(rr, 500, "Test error", nil)
+	req := httptest.NewRequest("GET", "/events", nil)
+	errorResponse(rr, req, 500, "Test error", nil)
 	var resp map[string]string
 	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
 		t.Fatalf("Failed to decode error response: %v", err)
@@ -91,13 +92,16 @@ func TestGetEventsHandler(t *testing.T) {
 	testEvents := []Event{
 		{Title: "Dummy Event", Start: "2023-03-01T09:00:00Z", End: "2023-03-01T10:00:00Z"},
 	}
-	eventCache.Set("events", testEvents, cache.DefaultExpiration)
+	timeMin, timeMax := defaultWindow(time.Now().Truncate(time.Minute))
+	eq := eventQuery{timeMin: timeMin, timeMax: timeMax}
+	eventCache.Set(eq.cacheKey("dummyCalendarID", false), testEvents, cache.DefaultExpiration)
 
 	req := httptest.NewRequest("GET", "/events", nil)
 	rr := httptest.NewRecorder()
 
 	// カレンダーサービスはキャッシュヒットを前提として nil でもOK
-	handler := getEventsHandler(nil, "dummyCalendarID")
+	cfg := parseCalendarConfig("dummyCalendarID")
+	handler := getEventsHandler(nil, cfg, 0)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != 200 {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metricsNamespace prefixes every metric exposed on /metrics, following
+// Prometheus's own naming convention.
+const metricsNamespace = "gcaljson"
+
+var (
+	// httpRequestsTotal counts completed HTTP requests by route (the
+	// registered mux pattern, not the raw path, to keep cardinality bounded
+	// for /events/{calendarId}), method and status code.
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	// httpRequestDuration observes handler latency by route and method.
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request handling latency in seconds, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// providerCallsTotal counts calls to EventProvider.List by backend
+	// (GCALJSON_PROVIDER) and outcome, so operators can see the error rate
+	// of the Google Calendar or CalDAV backend currently in use.
+	providerCallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_calls_total",
+		Help:      "Total number of calendar backend List calls, by provider and outcome (ok/error).",
+	}, []string{"provider", "outcome"})
+
+	// providerCallDuration observes calendar backend latency by provider.
+	providerCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_call_duration_seconds",
+		Help:      "Calendar backend List call latency in seconds, by provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	// cacheHitsTotal and cacheMissesTotal count fetchCalendarEvents's
+	// eventCache lookups.
+	cacheHitsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_hits_total",
+		Help:      "Total number of per-calendar event cache hits.",
+	})
+	cacheMissesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_misses_total",
+		Help:      "Total number of per-calendar event cache misses.",
+	})
+)
+
+// registerCachedEventsGauge exposes the total number of events currently held
+// across all entries of eventCache. It's a GaugeFunc rather than a plain
+// Gauge since eventCache is only created once main() has parsed
+// GCALJSON_CACHE_DURATION, and its contents can only be summed at scrape
+// time.
+func registerCachedEventsGauge() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cached_events",
+		Help:      "Total number of events currently held in the event cache, summed across all cached calendar/window/query combinations.",
+	}, func() float64 {
+		if eventCache == nil {
+			return 0
+		}
+		total := 0
+		for _, item := range eventCache.Items() {
+			if events, ok := item.Object.([]Event); ok {
+				total += len(events)
+			}
+		}
+		return float64(total)
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import "context"
+
+// activeProviderName is the GCALJSON_PROVIDER value in effect, set once in
+// main(). It labels the provider_calls_total/provider_call_duration_seconds
+// metrics recorded by fetchCalendarEvents.
+var activeProviderName = "unknown"
+
+// EventProvider fetches events for a single calendar from a backend calendar
+// server (Google Calendar, CalDAV, ...). calendars.go's fetchEvents and
+// fetchCalendarEvents handle the concurrency, caching and per-event
+// CalendarID/Color tagging that's common to every backend, so a provider only
+// needs to know how to talk to its own server.
+type EventProvider interface {
+	// List returns the events in calendarID that fall within eq's time
+	// window (and, if set, eq.q/eq.maxResults). If raw is true, recurring
+	// events are returned as their master event with RRULE/EXDATE/RDATE
+	// preserved in Event.RRule for iCal output; otherwise recurring events
+	// are expanded into individual instances.
+	List(ctx context.Context, calendarID string, raw bool, eq eventQuery) ([]Event, error)
+
+	// HealthCheck performs a lightweight round-trip against calendarID to
+	// verify the backend is reachable and the configured credentials are
+	// still valid. It's used by the /healthz endpoint so a Kubernetes
+	// readiness probe can catch an expired service account or unreachable
+	// CalDAV server before it causes user-facing request failures.
+	HealthCheck(ctx context.Context, calendarID string) error
+}
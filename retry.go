@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// retryConfig holds the tunable knobs for retryWithBackoff. It's populated
+// from GCALJSON_RETRY_MAX / GCALJSON_RETRY_MIN_DELAY / GCALJSON_RETRY_MAX_DELAY
+// in main(), defaulting to a 10-attempt backoff between 1s and 100s.
+type retryConfig struct {
+	maxAttempts int
+	minDelay    time.Duration
+	maxDelay    time.Duration
+}
+
+var apiRetryConfig = retryConfig{
+	maxAttempts: 10,
+	minDelay:    time.Second,
+	maxDelay:    100 * time.Second,
+}
+
+// isRetryableError reports whether err is a transient failure worth retrying:
+// HTTP 429/500/502/503/504 from the Calendar API, or a network-level timeout.
+// Non-timeout network errors (e.g. a permanently broken DNS lookup or route)
+// are treated as fatal so a misconfigured network fails fast instead of
+// burning through the full retry budget.
+func isRetryableError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// retryAfterDelay extracts the delay requested by a Retry-After header on a
+// googleapi.Error, if present, as either a number of seconds or an HTTP-date.
+func retryAfterDelay(err error) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Header == nil {
+		return 0, false
+	}
+	v := apiErr.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, convErr := strconv.Atoi(v); convErr == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, convErr := http.ParseTime(v); convErr == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// backoffDelay computes a jittered exponential delay for the given 0-based
+// attempt, doubling cfg.minDelay each attempt and clamping to cfg.maxDelay.
+// Using "full jitter" (a uniform draw between minDelay and the capped delay)
+// avoids every retrying client converging on the same delay.
+func backoffDelay(cfg retryConfig, attempt int) time.Duration {
+	delay := cfg.minDelay * time.Duration(uint64(1)<<uint(attempt))
+	if delay <= 0 || delay > cfg.maxDelay {
+		delay = cfg.maxDelay
+	}
+	if delay <= cfg.minDelay {
+		return cfg.minDelay
+	}
+	return cfg.minDelay + time.Duration(rand.Int63n(int64(delay-cfg.minDelay)))
+}
+
+// retryWithBackoff calls fn up to cfg.maxAttempts times, retrying transient
+// errors (see isRetryableError) with exponential backoff and jitter between
+// attempts. It honors a Retry-After header when the API supplies one, and
+// aborts immediately if ctx is canceled.
+func retryWithBackoff(ctx context.Context, cfg retryConfig, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < cfg.maxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if !isRetryableError(err) || attempt == cfg.maxAttempts-1 {
+			return err
+		}
+
+		delay, ok := retryAfterDelay(err)
+		if !ok {
+			delay = backoffDelay(cfg, attempt)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"server error", &googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+		{"not found", &googleapi.Error{Code: http.StatusNotFound}, false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tc := range cases {
+		if got := isRetryableError(tc.err); got != tc.want {
+			t.Errorf("%s: isRetryableError() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	err := &googleapi.Error{
+		Code:   http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After": []string{"2"}},
+	}
+	d, ok := retryAfterDelay(err)
+	if !ok || d != 2*time.Second {
+		t.Errorf("retryAfterDelay() = %v, %v, want 2s, true", d, ok)
+	}
+
+	if _, ok := retryAfterDelay(errors.New("boom")); ok {
+		t.Error("expected no Retry-After for a non-googleapi error")
+	}
+}
+
+func TestBackoffDelayIsBounded(t *testing.T) {
+	cfg := retryConfig{maxAttempts: 10, minDelay: time.Second, maxDelay: 10 * time.Second}
+	for attempt := 0; attempt < 10; attempt++ {
+		d := backoffDelay(cfg, attempt)
+		if d < cfg.minDelay || d > cfg.maxDelay {
+			t.Errorf("backoffDelay(attempt=%d) = %v, want within [%v, %v]", attempt, d, cfg.minDelay, cfg.maxDelay)
+		}
+	}
+}
+
+func TestRetryWithBackoffRetriesThenSucceeds(t *testing.T) {
+	cfg := retryConfig{maxAttempts: 3, minDelay: time.Millisecond, maxDelay: 2 * time.Millisecond}
+	attempts := 0
+	err := retryWithBackoff(context.Background(), cfg, func() error {
+		attempts++
+		if attempts < 3 {
+			return &googleapi.Error{Code: http.StatusServiceUnavailable}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected eventual success, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryWithBackoffGivesUpOnNonRetryableError(t *testing.T) {
+	cfg := retryConfig{maxAttempts: 5, minDelay: time.Millisecond, maxDelay: time.Millisecond}
+	attempts := 0
+	wantErr := &googleapi.Error{Code: http.StatusNotFound}
+	err := retryWithBackoff(context.Background(), cfg, func() error {
+		attempts++
+		return wantErr
+	})
+	if err != wantErr {
+		t.Errorf("expected immediate non-retryable error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetryWithBackoffAbortsOnContextCancel(t *testing.T) {
+	cfg := retryConfig{maxAttempts: 10, minDelay: time.Hour, maxDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := retryWithBackoff(ctx, cfg, func() error {
+		return &googleapi.Error{Code: http.StatusServiceUnavailable}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// eventQuery captures the per-request knobs that are passed through to
+// srv.Events.List: the time window, an optional full-text search term and
+// an optional result cap. It's also the basis of the cache key, so two
+// requests with different windows or queries never clobber each other's
+// cached results.
+type eventQuery struct {
+	timeMin    time.Time
+	timeMax    time.Time
+	q          string
+	maxResults int64
+}
+
+// cacheKey uniquely identifies this query against a single calendar.
+func (eq eventQuery) cacheKey(calendarID string, raw bool) string {
+	return fmt.Sprintf("%s:%v:%s:%s:%s:%d",
+		calendarID, raw,
+		eq.timeMin.UTC().Format(time.RFC3339), eq.timeMax.UTC().Format(time.RFC3339),
+		eq.q, eq.maxResults)
+}
+
+// parseEventQuery builds an eventQuery from the timeMin/timeMax/q/maxResults
+// query parameters, falling back to defaultWindow when timeMin/timeMax are
+// omitted. A window wider than maxWindow is rejected so a single request
+// can't force unbounded Calendar API usage; maxWindow <= 0 disables the check.
+func parseEventQuery(r *http.Request, maxWindow time.Duration) (eventQuery, error) {
+	// now を分単位に丸めることで、同じ相対指定（例: timeMin=-30d）による
+	// ポーリングが短時間のうちにキャッシュキーをすり抜けないようにする。
+	now := time.Now().Truncate(time.Minute)
+	timeMin, timeMax := defaultWindow(now)
+
+	query := r.URL.Query()
+	if v := query.Get("timeMin"); v != "" {
+		t, err := parseTimeParam(v, now)
+		if err != nil {
+			return eventQuery{}, fmt.Errorf("invalid timeMin %q: %w", v, err)
+		}
+		timeMin = t
+	}
+	if v := query.Get("timeMax"); v != "" {
+		t, err := parseTimeParam(v, now)
+		if err != nil {
+			return eventQuery{}, fmt.Errorf("invalid timeMax %q: %w", v, err)
+		}
+		timeMax = t
+	}
+	if timeMax.Before(timeMin) {
+		return eventQuery{}, fmt.Errorf("timeMax must not be before timeMin")
+	}
+	if maxWindow > 0 {
+		if span := timeMax.Sub(timeMin); span > maxWindow {
+			return eventQuery{}, fmt.Errorf("requested window %s exceeds the maximum of %s", span, maxWindow)
+		}
+	}
+
+	eq := eventQuery{timeMin: timeMin, timeMax: timeMax, q: query.Get("q")}
+
+	if v := query.Get("maxResults"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return eventQuery{}, fmt.Errorf("invalid maxResults %q", v)
+		}
+		eq.maxResults = int64(n)
+	}
+
+	return eq, nil
+}
+
+// parseTimeParam accepts either an RFC3339 timestamp or a duration relative
+// to now, such as "-30d" or "+90d".
+func parseTimeParam(s string, now time.Time) (time.Time, error) {
+	if d, ok := parseRelativeDuration(s); ok {
+		return now.Add(d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseRelativeDuration parses a signed, single-unit duration such as
+// "-30d", "+12h" or "-2w". It does not accept plain time.ParseDuration
+// syntax since "d" (days) and "w" (weeks) aren't supported by the standard
+// library but are the natural units for a calendar window.
+func parseRelativeDuration(s string) (time.Duration, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	sign := time.Duration(1)
+	switch s[0] {
+	case '+':
+		s = s[1:]
+	case '-':
+		sign = -1
+		s = s[1:]
+	default:
+		return 0, false
+	}
+	if len(s) < 2 {
+		return 0, false
+	}
+
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'd':
+		unit = 24 * time.Hour
+	case 'h':
+		unit = time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	default:
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, false
+	}
+	return sign * time.Duration(n) * unit, true
+}
+
+// parseSpan parses an unsigned, positive duration in the same "<n><d|h|w>"
+// notation used by GCALJSON_MAX_WINDOW (e.g. "365d").
+func parseSpan(s string) (time.Duration, error) {
+	d, ok := parseRelativeDuration("+" + s)
+	if !ok || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
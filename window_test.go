@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRelativeDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"-30d": -30 * 24 * time.Hour,
+		"+90d": 90 * 24 * time.Hour,
+		"-2w":  -2 * 7 * 24 * time.Hour,
+		"+6h":  6 * time.Hour,
+	}
+	for in, want := range cases {
+		got, ok := parseRelativeDuration(in)
+		if !ok {
+			t.Errorf("parseRelativeDuration(%q) failed to parse", in)
+			continue
+		}
+		if got != want {
+			t.Errorf("parseRelativeDuration(%q) = %v, want %v", in, got, want)
+		}
+	}
+
+	if _, ok := parseRelativeDuration("30d"); ok {
+		t.Error("Expected a missing sign to be rejected")
+	}
+	if _, ok := parseRelativeDuration("+30x"); ok {
+		t.Error("Expected an unknown unit to be rejected")
+	}
+}
+
+func TestParseEventQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events?timeMin=-7d&timeMax=%2B7d&q=standup&maxResults=10", nil)
+	eq, err := parseEventQuery(req, 0)
+	if err != nil {
+		t.Fatalf("parseEventQuery returned error: %v", err)
+	}
+	if eq.q != "standup" {
+		t.Errorf("Expected q 'standup', got %q", eq.q)
+	}
+	if eq.maxResults != 10 {
+		t.Errorf("Expected maxResults 10, got %d", eq.maxResults)
+	}
+	if !eq.timeMax.After(eq.timeMin) {
+		t.Errorf("Expected timeMax after timeMin, got %v, %v", eq.timeMin, eq.timeMax)
+	}
+}
+
+func TestParseEventQueryRejectsWideWindow(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events?timeMin=-400d&timeMax=%2B1d", nil)
+	if _, err := parseEventQuery(req, 365*24*time.Hour); err == nil {
+		t.Error("Expected an error for a window wider than maxWindow")
+	}
+}
+
+func TestParseEventQueryRejectsInvertedWindow(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events?timeMin=%2B7d&timeMax=-7d", nil)
+	if _, err := parseEventQuery(req, 0); err == nil {
+		t.Error("Expected an error when timeMax is before timeMin")
+	}
+}
+
+func TestParseSpanRejectsNegative(t *testing.T) {
+	if _, err := parseSpan("-10d"); err == nil {
+		t.Error("Expected an error for a negative GCALJSON_MAX_WINDOW")
+	}
+	d, err := parseSpan("365d")
+	if err != nil || d != 365*24*time.Hour {
+		t.Errorf("parseSpan(\"365d\") = %v, %v", d, err)
+	}
+}